@@ -0,0 +1,51 @@
+// Copyright 2016 The prometheus-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alertmanager
+
+import (
+	"k8s.io/client-go/pkg/api/v1"
+	metav1 "k8s.io/client-go/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/apis/policy/v1beta1"
+	"k8s.io/client-go/pkg/util/intstr"
+
+	"github.com/coreos/prometheus-operator/pkg/spec"
+)
+
+// makePodDisruptionBudget builds a PodDisruptionBudget that keeps at least
+// replicas-1 Alertmanager pods available, so a voluntary disruption (node
+// drain, rolling cluster upgrade) can't take down enough replicas to break
+// the mesh's quorum.
+func makePodDisruptionBudget(am *spec.Alertmanager) *v1beta1.PodDisruptionBudget {
+	replicas := am.Spec.Replicas
+	if replicas < 1 {
+		replicas = 1
+	}
+	minAvailable := intstr.FromInt(int(replicas - 1))
+
+	return &v1beta1.PodDisruptionBudget{
+		ObjectMeta: v1.ObjectMeta{
+			Name: am.Name,
+		},
+		Spec: v1beta1.PodDisruptionBudgetSpec{
+			MinAvailable: &minAvailable,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"app":          "alertmanager",
+					"alertmanager": am.Name,
+				},
+			},
+		},
+	}
+}
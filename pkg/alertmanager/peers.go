@@ -0,0 +1,109 @@
+// Copyright 2016 The prometheus-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alertmanager
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/coreos/prometheus-operator/pkg/spec"
+)
+
+const meshPortName = "mesh"
+
+// peersFromEndpoints resolves the current mesh peer addresses from the
+// live Endpoints object backing the headless "alertmanager" Service.
+// Earlier versions assumed the StatefulSet-generated DNS name
+// "<pod>.alertmanager.<namespace>.svc" would resolve for every peer, but
+// the peer list built from it keeps referencing scaled-down pods until the
+// StatefulSet is re-rendered for an unrelated reason. Resolving peers off
+// the Endpoints object drops peers as soon as they leave the Service. Only
+// ready addresses (Subsets[].Addresses) are used; NotReadyAddresses are
+// skipped.
+func peersFromEndpoints(kclient kubernetes.Interface, ns string) ([]string, error) {
+	eps, err := kclient.Core().Endpoints(ns).Get("alertmanager")
+	if err != nil {
+		return nil, fmt.Errorf("get endpoints %s/alertmanager: %s", ns, err)
+	}
+
+	var peers []string
+	for _, ss := range eps.Subsets {
+		var meshPort int32
+		for _, p := range ss.Ports {
+			if p.Name == meshPortName {
+				meshPort = p.Port
+			}
+		}
+		if meshPort == 0 {
+			continue
+		}
+		for _, addr := range ss.Addresses {
+			peers = append(peers, fmt.Sprintf("%s:%d", addr.IP, meshPort))
+		}
+	}
+	return peers, nil
+}
+
+// peersEqual reports whether two peer lists contain the same addresses,
+// ignoring order - the order peersFromEndpoints returns addresses in
+// depends on Endpoints.Subsets ordering, which the API makes no guarantee
+// about, so a literal slice comparison would churn on every call even when
+// membership hasn't actually changed.
+func peersEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = append([]string{}, a...), append([]string{}, b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	return reflect.DeepEqual(a, b)
+}
+
+// ReconcilePeers resolves the current mesh membership for am from the
+// headless Service's Endpoints plus any explicitly configured
+// AdditionalPeers, re-renders the StatefulSet if the peer list differs from
+// the one recorded in am.Status by the last reconcile, and records the
+// resolved membership in am.Status. Only the in-memory object is updated;
+// am's status subresource on the API server is not written here. It is
+// meant to be invoked whenever the "alertmanager" Endpoints object changes,
+// so that a scale-up
+// or scale-down is reflected in the mesh immediately rather than on the
+// next unrelated StatefulSet update.
+func ReconcilePeers(kclient kubernetes.Interface, am *spec.Alertmanager) error {
+	peers, err := peersFromEndpoints(kclient, am.Namespace)
+	if err != nil {
+		return err
+	}
+	peers = append(peers, am.Spec.AdditionalPeers...)
+
+	if am.Status != nil && peersEqual(am.Status.Peers, peers) {
+		return nil
+	}
+
+	sset, err := kclient.Apps().StatefulSets(am.Namespace).Get(am.Name)
+	if err != nil {
+		return fmt.Errorf("get statefulset %s/%s: %s", am.Namespace, am.Name, err)
+	}
+
+	if _, err := kclient.Apps().StatefulSets(am.Namespace).Update(makeStatefulSet(am, sset, peers)); err != nil {
+		return fmt.Errorf("update statefulset %s/%s: %s", am.Namespace, am.Name, err)
+	}
+
+	am.Status = &spec.AlertmanagerStatus{Peers: peers}
+	return nil
+}
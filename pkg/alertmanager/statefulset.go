@@ -20,12 +20,13 @@ import (
 	"k8s.io/client-go/pkg/api/resource"
 	"k8s.io/client-go/pkg/api/v1"
 	"k8s.io/client-go/pkg/apis/apps/v1beta1"
+	metav1 "k8s.io/client-go/pkg/apis/meta/v1"
 	"k8s.io/client-go/pkg/util/intstr"
 
 	"github.com/coreos/prometheus-operator/pkg/spec"
 )
 
-func makeStatefulSet(am *spec.Alertmanager, old *v1beta1.StatefulSet) *v1beta1.StatefulSet {
+func makeStatefulSet(am *spec.Alertmanager, old *v1beta1.StatefulSet, peers []string) *v1beta1.StatefulSet {
 	// TODO(fabxc): is this the right point to inject defaults?
 	// Ideally we would do it before storing but that's currently not possible.
 	// Potentially an update handler on first insertion.
@@ -48,7 +49,7 @@ func makeStatefulSet(am *spec.Alertmanager, old *v1beta1.StatefulSet) *v1beta1.S
 		ObjectMeta: v1.ObjectMeta{
 			Name: am.Name,
 		},
-		Spec: makeStatefulSetSpec(am.Namespace, am.Name, image, version, replicas),
+		Spec: makeStatefulSetSpec(am, image, replicas, peers),
 	}
 	if vc := am.Spec.Storage; vc == nil {
 		statefulset.Spec.Template.Spec.Volumes = append(statefulset.Spec.Template.Spec.Volumes, v1.Volume{
@@ -111,7 +112,29 @@ func makeStatefulSetService(p *spec.Alertmanager) *v1.Service {
 	return svc
 }
 
-func makeStatefulSetSpec(ns, name, image, version string, replicas int32) v1beta1.StatefulSetSpec {
+// defaultAntiAffinity builds a soft pod anti-affinity rule that prefers
+// spreading Alertmanager pods carrying podLabels across nodes, so that a
+// single node failure does not take down the whole cluster.
+func defaultAntiAffinity(podLabels map[string]string) *v1.Affinity {
+	return &v1.Affinity{
+		PodAntiAffinity: &v1.PodAntiAffinity{
+			PreferredDuringSchedulingIgnoredDuringExecution: []v1.WeightedPodAffinityTerm{
+				{
+					Weight: 100,
+					PodAffinityTerm: v1.PodAffinityTerm{
+						LabelSelector: &metav1.LabelSelector{
+							MatchLabels: podLabels,
+						},
+						TopologyKey: "kubernetes.io/hostname",
+					},
+				},
+			},
+		},
+	}
+}
+
+func makeStatefulSetSpec(am *spec.Alertmanager, image string, replicas int32, peers []string) v1beta1.StatefulSetSpec {
+	name := am.Name
 	commands := []string{
 		"/bin/alertmanager",
 		fmt.Sprintf("-config.file=%s", "/etc/alertmanager/config/alertmanager.yaml"),
@@ -119,8 +142,18 @@ func makeStatefulSetSpec(ns, name, image, version string, replicas int32) v1beta
 		fmt.Sprintf("-mesh.listen-address=:%d", 6783),
 		fmt.Sprintf("-storage.path=%s", "/etc/alertmanager/data"),
 	}
-	for i := int32(0); i < replicas; i++ {
-		commands = append(commands, fmt.Sprintf("-mesh.peer=%s-%d.%s.%s.svc", name, i, "alertmanager", ns))
+	for _, peer := range peers {
+		commands = append(commands, fmt.Sprintf("-mesh.peer=%s", peer))
+	}
+
+	podLabels := map[string]string{
+		"app":          "alertmanager",
+		"alertmanager": name,
+	}
+
+	affinity := am.Spec.Affinity
+	if affinity == nil && replicas > 1 {
+		affinity = defaultAntiAffinity(podLabels)
 	}
 
 	terminationGracePeriod := int64(0)
@@ -129,13 +162,13 @@ func makeStatefulSetSpec(ns, name, image, version string, replicas int32) v1beta
 		Replicas:    &replicas,
 		Template: v1.PodTemplateSpec{
 			ObjectMeta: v1.ObjectMeta{
-				Labels: map[string]string{
-					"app":          "alertmanager",
-					"alertmanager": name,
-				},
+				Labels: podLabels,
 			},
 			Spec: v1.PodSpec{
 				TerminationGracePeriodSeconds: &terminationGracePeriod,
+				NodeSelector:                  am.Spec.NodeSelector,
+				Affinity:                      affinity,
+				Tolerations:                   am.Spec.Tolerations,
 				Containers: []v1.Container{
 					{
 						Command: commands,
@@ -0,0 +1,64 @@
+// Copyright 2016 The prometheus-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"fmt"
+
+	"k8s.io/client-go/kubernetes"
+	metav1 "k8s.io/client-go/pkg/apis/meta/v1"
+
+	"github.com/coreos/prometheus-operator/pkg/spec"
+)
+
+// resolveNamespaces turns a NamespaceSelector into a concrete list of
+// namespace names to discover scrape targets in. A nil return means "no
+// restriction" (discover across the whole cluster); an empty non-nil return
+// means a label Selector matched no namespace.
+//
+// Any takes precedence, followed by an explicit MatchNames list. If
+// neither is set and a label Selector is given, it is resolved against the
+// cluster's Namespace objects. With nothing set at all, discovery is
+// scoped to defaultNamespace (the ServiceMonitor's own namespace).
+func resolveNamespaces(kclient kubernetes.Interface, nsel spec.NamespaceSelector, defaultNamespace string) ([]string, error) {
+	if nsel.Any {
+		return nil, nil
+	}
+	if len(nsel.MatchNames) > 0 {
+		return nsel.MatchNames, nil
+	}
+	if nsel.Selector != nil {
+		// LabelSelectorAsSelector (rather than hand-joining MatchLabels) so
+		// MatchExpressions is honored too - a selector that only sets
+		// MatchExpressions must not silently fall through to "no
+		// restriction".
+		selector, err := metav1.LabelSelectorAsSelector(nsel.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid namespace selector: %s", err)
+		}
+		list, err := kclient.Core().Namespaces().List(metav1.ListOptions{
+			LabelSelector: selector.String(),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("list namespaces matching selector: %s", err)
+		}
+		names := make([]string, 0, len(list.Items))
+		for _, ns := range list.Items {
+			names = append(names, ns.Name)
+		}
+		return names, nil
+	}
+	return []string{defaultNamespace}, nil
+}
@@ -20,6 +20,7 @@ import (
 	"strings"
 
 	yaml "gopkg.in/yaml.v2"
+	"k8s.io/client-go/kubernetes"
 	metav1 "k8s.io/client-go/pkg/apis/meta/v1"
 
 	"github.com/coreos/prometheus-operator/pkg/spec"
@@ -33,7 +34,7 @@ func sanitizeLabelName(name string) string {
 	return invalidLabelCharRE.ReplaceAllString(name, "_")
 }
 
-func generateConfig(p *spec.Prometheus, mons map[string]*spec.ServiceMonitor) ([]byte, error) {
+func generateConfig(kclient kubernetes.Interface, p *spec.Prometheus, mons map[string]*spec.ServiceMonitor, rules map[string]*spec.PrometheusRule) ([]byte, error) {
 	cfg := map[string]interface{}{}
 
 	cfg["global"] = map[string]string{
@@ -41,12 +42,32 @@ func generateConfig(p *spec.Prometheus, mons map[string]*spec.ServiceMonitor) ([
 		"scrape_interval":     "30s",
 	}
 
-	cfg["rule_files"] = []string{"/etc/prometheus/rules/*.rules"}
+	selected, err := selectRules(rules, p.Spec.RuleSelector)
+	if err != nil {
+		return nil, fmt.Errorf("select rules for prometheus %s/%s: %s", p.Namespace, p.Name, err)
+	}
+	ruleFiles := ruleFilePaths(selected)
+	if len(ruleFiles) == 0 {
+		// No PrometheusRule objects were selected (or RuleSelector is unset).
+		// Keep the glob so rule files dropped directly into ruleFilesDir by
+		// other means still get picked up.
+		ruleFiles = []string{fmt.Sprintf("%s/*.rules", ruleFilesDir)}
+	}
+	cfg["rule_files"] = ruleFiles
 
 	var scrapeConfigs []interface{}
 	for _, mon := range mons {
+		namespaces, err := resolveNamespaces(kclient, mon.Spec.NamespaceSelector, mon.Namespace)
+		if err != nil {
+			return nil, fmt.Errorf("resolve namespaces for servicemonitor %s/%s: %s", mon.Namespace, mon.Name, err)
+		}
+		if namespaces != nil && len(namespaces) == 0 {
+			// The label selector matched no namespace, so there is nothing
+			// to discover; an empty list must not mean "no restriction".
+			continue
+		}
 		for i, ep := range mon.Spec.Endpoints {
-			scrapeConfigs = append(scrapeConfigs, generateServiceMonitorConfig(mon, ep, i))
+			scrapeConfigs = append(scrapeConfigs, generateServiceMonitorConfig(mon, ep, i, namespaces))
 		}
 	}
 	var alertmanagerConfigs []interface{}
@@ -62,13 +83,30 @@ func generateConfig(p *spec.Prometheus, mons map[string]*spec.ServiceMonitor) ([
 	return yaml.Marshal(cfg)
 }
 
-func generateServiceMonitorConfig(m *spec.ServiceMonitor, ep spec.Endpoint, i int) interface{} {
+func generateServiceMonitorConfig(m *spec.ServiceMonitor, ep spec.Endpoint, i int, namespaces []string) interface{} {
+	role := "endpoints"
+	if ep.Role == "pod" {
+		role = "pod"
+	}
+
+	sdConfig := map[string]interface{}{
+		"role": role,
+	}
+	// Restrict service discovery to the resolved namespaces (nil means no
+	// restriction, i.e. the NamespaceSelector selected "any"). Without
+	// this, every downstream relabeling rule would need to be
+	// namespace-aware, and Prometheus would needlessly discover targets
+	// cluster-wide just to drop most of them again.
+	if len(namespaces) > 0 {
+		sdConfig["namespaces"] = map[string]interface{}{
+			"names": namespaces,
+		}
+	}
+
 	cfg := map[string]interface{}{
 		"job_name": fmt.Sprintf("%s/%s/%d", m.Namespace, m.Name, i),
 		"kubernetes_sd_configs": []map[string]interface{}{
-			{
-				"role": "endpoints",
-			},
+			sdConfig,
 		},
 	}
 
@@ -81,6 +119,30 @@ func generateServiceMonitorConfig(m *spec.ServiceMonitor, ep spec.Endpoint, i in
 	if ep.Scheme != "" {
 		cfg["scheme"] = ep.Scheme
 	}
+	if ep.TLSConfig != nil {
+		cfg["tls_config"] = generateTLSConfig(ep.TLSConfig)
+	}
+	if ep.BearerTokenSecret != nil {
+		cfg["bearer_token_file"] = secretPath(ep.BearerTokenSecret.Name, ep.BearerTokenSecret.Key)
+	}
+	if ep.BasicAuth != nil {
+		basicAuth := map[string]interface{}{
+			"username": ep.BasicAuth.Username,
+		}
+		if ep.BasicAuth.Password != nil {
+			basicAuth["password_file"] = secretPath(ep.BasicAuth.Password.Name, ep.BasicAuth.Password.Key)
+		}
+		cfg["basic_auth"] = basicAuth
+	}
+
+	// The label prefix service discovery exposes target labels under
+	// differs by role: the endpoints role surfaces the labels of the
+	// backing Service, while the pod role has no Service in the picture
+	// and only surfaces the Pod's own labels.
+	labelPrefix := "__meta_kubernetes_service_label_"
+	if role == "pod" {
+		labelPrefix = "__meta_kubernetes_pod_label_"
+	}
 
 	var relabelings []interface{}
 
@@ -90,7 +152,7 @@ func generateServiceMonitorConfig(m *spec.ServiceMonitor, ep spec.Endpoint, i in
 	for k, v := range m.Spec.Selector.MatchLabels {
 		relabelings = append(relabelings, map[string]interface{}{
 			"action":        "keep",
-			"source_labels": []string{"__meta_kubernetes_service_label_" + sanitizeLabelName(k)},
+			"source_labels": []string{labelPrefix + sanitizeLabelName(k)},
 			"regex":         v,
 		})
 	}
@@ -101,60 +163,55 @@ func generateServiceMonitorConfig(m *spec.ServiceMonitor, ep spec.Endpoint, i in
 		case metav1.LabelSelectorOpIn:
 			relabelings = append(relabelings, map[string]interface{}{
 				"action":        "keep",
-				"source_labels": []string{"__meta_kubernetes_service_label_" + sanitizeLabelName(exp.Key)},
+				"source_labels": []string{labelPrefix + sanitizeLabelName(exp.Key)},
 				"regex":         strings.Join(exp.Values, "|"),
 			})
 		case metav1.LabelSelectorOpNotIn:
 			relabelings = append(relabelings, map[string]interface{}{
 				"action":        "drop",
-				"source_labels": []string{"__meta_kubernetes_service_label_" + sanitizeLabelName(exp.Key)},
+				"source_labels": []string{labelPrefix + sanitizeLabelName(exp.Key)},
 				"regex":         strings.Join(exp.Values, "|"),
 			})
 		case metav1.LabelSelectorOpExists:
 			relabelings = append(relabelings, map[string]interface{}{
 				"action":        "keep",
-				"source_labels": []string{"__meta_kubernetes_service_label_" + sanitizeLabelName(exp.Key)},
+				"source_labels": []string{labelPrefix + sanitizeLabelName(exp.Key)},
 				"regex":         ".+",
 			})
 		case metav1.LabelSelectorOpDoesNotExist:
 			relabelings = append(relabelings, map[string]interface{}{
 				"action":        "drop",
-				"source_labels": []string{"__meta_kubernetes_service_label_" + sanitizeLabelName(exp.Key)},
+				"source_labels": []string{labelPrefix + sanitizeLabelName(exp.Key)},
 				"regex":         ".+",
 			})
 		}
 	}
 
-	// Filter targets based on the namespace selection configuration.
-	// By default we only discover services within the namespace of the
-	// ServiceMonitor.
-	// Selections allow extending this to all namespaces or to a subset
-	// of them specified by label or name matching.
-	//
-	// Label selections are not supported yet as they require either supported
-	// in the upstream SD integration or require out-of-band implementation
-	// in the operator with configuration reload.
-	//
-	// There's no explicit nil for the selector, we decide for the default
-	// case if it's all zero values.
-	nsel := m.Spec.NamespaceSelector
-
-	if !nsel.Any && len(nsel.MatchNames) == 0 {
-		relabelings = append(relabelings, map[string]interface{}{
-			"action":        "keep",
-			"source_labels": []string{"__meta_kubernetes_namespace"},
-			"regex":         m.Namespace,
-		})
-	} else if len(nsel.MatchNames) > 0 {
-		relabelings = append(relabelings, map[string]interface{}{
-			"action":        "keep",
-			"source_labels": []string{"__meta_kubernetes_namespace"},
-			"regex":         strings.Join(nsel.MatchNames, "|"),
-		})
-	}
-
-	// Filter targets based on correct port for the endpoint.
-	if ep.Port != "" {
+	// Filter targets based on correct port for the endpoint. The pod role
+	// has no named Service port to key off, so both Port and TargetPort
+	// are matched against the Pod's own container port metadata instead of
+	// the endpoints role's Service/container port labels.
+	if role == "pod" {
+		if ep.Port != "" {
+			relabelings = append(relabelings, map[string]interface{}{
+				"action":        "keep",
+				"source_labels": []string{"__meta_kubernetes_pod_container_port_name"},
+				"regex":         ep.Port,
+			})
+		} else if ep.TargetPort.StrVal != "" {
+			relabelings = append(relabelings, map[string]interface{}{
+				"action":        "keep",
+				"source_labels": []string{"__meta_kubernetes_pod_container_port_name"},
+				"regex":         ep.TargetPort.String(),
+			})
+		} else if ep.TargetPort.IntVal != 0 {
+			relabelings = append(relabelings, map[string]interface{}{
+				"action":        "keep",
+				"source_labels": []string{"__meta_kubernetes_pod_container_port_number"},
+				"regex":         ep.TargetPort.String(),
+			})
+		}
+	} else if ep.Port != "" {
 		relabelings = append(relabelings, map[string]interface{}{
 			"action":        "keep",
 			"source_labels": []string{"__meta_kubernetes_endpoint_port_name"},
@@ -197,18 +254,24 @@ func generateServiceMonitorConfig(m *spec.ServiceMonitor, ep spec.Endpoint, i in
 		},
 	}...)
 
-	// By default, generate a safe job name from the service name and scraped port.
-	// We also keep this around if a jobLabel is set in case the targets don't actually
-	// have a value for it.
+	// By default, generate a safe job name from the owning object's name and
+	// scraped port. For the endpoints role that's the Service name; for the
+	// pod role there's no Service in the picture, so we fall back to the
+	// Pod name. We also keep this around if a jobLabel is set in case the
+	// targets don't actually have a value for it.
+	nameLabel := "__meta_kubernetes_service_name"
+	if role == "pod" {
+		nameLabel = "__meta_kubernetes_pod_name"
+	}
 	if ep.Port != "" {
 		relabelings = append(relabelings, map[string]interface{}{
-			"source_labels": []string{"__meta_kubernetes_service_name"},
+			"source_labels": []string{nameLabel},
 			"target_label":  "job",
 			"replacement":   "${1}-" + ep.Port,
 		})
 	} else if ep.TargetPort.String() != "" {
 		relabelings = append(relabelings, map[string]interface{}{
-			"source_labels": []string{"__meta_kubernetes_service_name"},
+			"source_labels": []string{nameLabel},
 			"target_label":  "job",
 			"replacement":   "${1}-" + ep.TargetPort.String(),
 		})
@@ -218,14 +281,14 @@ func generateServiceMonitorConfig(m *spec.ServiceMonitor, ep spec.Endpoint, i in
 	if m.Spec.JobLabel != "" {
 		if ep.Port != "" {
 			relabelings = append(relabelings, map[string]interface{}{
-				"source_labels": []string{"__meta_kubernetes_service_label_" + sanitizeLabelName(m.Spec.JobLabel)},
+				"source_labels": []string{labelPrefix + sanitizeLabelName(m.Spec.JobLabel)},
 				"target_label":  "job",
 				"regex":         "(.+)",
 				"replacement":   "${1}-" + ep.Port,
 			})
 		} else if ep.TargetPort.String() != "" {
 			relabelings = append(relabelings, map[string]interface{}{
-				"source_labels": []string{"__meta_kubernetes_service_label_" + sanitizeLabelName(m.Spec.JobLabel)},
+				"source_labels": []string{labelPrefix + sanitizeLabelName(m.Spec.JobLabel)},
 				"target_label":  "job",
 				"regex":         "(.+)",
 				"replacement":   "${1}-" + ep.TargetPort.String(),
@@ -238,6 +301,26 @@ func generateServiceMonitorConfig(m *spec.ServiceMonitor, ep spec.Endpoint, i in
 	return cfg
 }
 
+func generateTLSConfig(tls *spec.TLSConfig) map[string]interface{} {
+	cfg := map[string]interface{}{}
+	if tls.CA != nil {
+		cfg["ca_file"] = secretPath(tls.CA.Name, tls.CA.Key)
+	}
+	if tls.Cert != nil {
+		cfg["cert_file"] = secretPath(tls.Cert.Name, tls.Cert.Key)
+	}
+	if tls.Key != nil {
+		cfg["key_file"] = secretPath(tls.Key.Name, tls.Key.Key)
+	}
+	if tls.ServerName != "" {
+		cfg["server_name"] = tls.ServerName
+	}
+	if tls.InsecureSkipVerify {
+		cfg["insecure_skip_verify"] = tls.InsecureSkipVerify
+	}
+	return cfg
+}
+
 func generateAlertmanagerConfig(am spec.AlertmanagerEndpoints) interface{} {
 	if am.Scheme == "" {
 		am.Scheme = "http"
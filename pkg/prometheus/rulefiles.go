@@ -0,0 +1,165 @@
+// Copyright 2016 The prometheus-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"fmt"
+	"sort"
+
+	yaml "gopkg.in/yaml.v2"
+	"k8s.io/client-go/pkg/api/v1"
+	metav1 "k8s.io/client-go/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/labels"
+
+	"github.com/coreos/prometheus-operator/pkg/spec"
+)
+
+const ruleFilesDir = "/etc/prometheus/rules"
+
+// ruleFileName returns the file name a PrometheusRule's rule groups are
+// rendered under. It is namespaced so that rule files originating from
+// different PrometheusRule objects can never collide.
+func ruleFileName(pr *spec.PrometheusRule) string {
+	return fmt.Sprintf("%s-%s.rules", pr.Namespace, pr.Name)
+}
+
+// selectRules narrows the candidate PrometheusRule objects a caller has
+// listed down to the ones selected by a Prometheus resource's RuleSelector.
+// A nil selector selects nothing, matching PrometheusSpec.RuleSelector's
+// documented default.
+func selectRules(prs map[string]*spec.PrometheusRule, sel *metav1.LabelSelector) (map[string]*spec.PrometheusRule, error) {
+	if sel == nil {
+		return nil, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(sel)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rule selector: %s", err)
+	}
+	selected := make(map[string]*spec.PrometheusRule, len(prs))
+	for k, pr := range prs {
+		if selector.Matches(labels.Set(pr.Labels)) {
+			selected[k] = pr
+		}
+	}
+	return selected, nil
+}
+
+// validateRuleGroups rejects a PrometheusRule whose groups `promtool check
+// rules` would also reject, so that a single malformed object can't corrupt
+// every other tenant's rule file in the same ConfigMap. Full expression
+// parsing is left to the promtool init container mounted alongside the
+// rendered ConfigMap; this catches the structural mistakes that are cheap
+// to check before that point.
+func validateRuleGroups(pr *spec.PrometheusRule) error {
+	seen := map[string]struct{}{}
+	for _, g := range pr.Spec.Groups {
+		if g.Name == "" {
+			return fmt.Errorf("group has no name")
+		}
+		if _, ok := seen[g.Name]; ok {
+			return fmt.Errorf("duplicate group name %q", g.Name)
+		}
+		seen[g.Name] = struct{}{}
+
+		for _, r := range g.Rules {
+			if r.Expr == "" {
+				return fmt.Errorf("group %q: rule has no expr", g.Name)
+			}
+			if (r.Record == "") == (r.Alert == "") {
+				return fmt.Errorf("group %q: rule must set exactly one of record or alert", g.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// generateRuleFileConfigs renders each valid PrometheusRule's groups to the
+// YAML rule file format understood by Prometheus, keyed by the file name
+// they should be stored under. Rules that fail validateRuleGroups are
+// omitted and reported in the second return value, keyed the same way a
+// future controller would key Events against the source object
+// (namespace/name), so a bad PrometheusRule can't keep the rest of the
+// ConfigMap from being generated.
+//
+// Each PrometheusRule's Status is also set directly on the object to record
+// the validation outcome, the same way ReconcilePeers publishes resolved
+// membership onto an Alertmanager's Status: whatever lister populated the
+// rules map owns persisting it back to the API server via a status Update,
+// which is outside the scope of this package since no such controller
+// exists in this tree yet.
+func generateRuleFileConfigs(rules map[string]*spec.PrometheusRule) (map[string]string, map[string]error, error) {
+	files := make(map[string]string, len(rules))
+	invalid := make(map[string]error)
+	for _, pr := range rules {
+		key := fmt.Sprintf("%s/%s", pr.Namespace, pr.Name)
+		if err := validateRuleGroups(pr); err != nil {
+			invalid[key] = err
+			pr.Status = &spec.PrometheusRuleStatus{Valid: false, Reason: err.Error()}
+			continue
+		}
+		pr.Status = &spec.PrometheusRuleStatus{Valid: true}
+		b, err := yaml.Marshal(map[string]interface{}{"groups": pr.Spec.Groups})
+		if err != nil {
+			return nil, nil, fmt.Errorf("marshal rule file for %s: %s", key, err)
+		}
+		files[ruleFileName(pr)] = string(b)
+	}
+	return files, invalid, nil
+}
+
+// makeRulesConfigMap reconciles the desired ConfigMap holding the rendered
+// rule files for the given PrometheusRule objects. It is mounted into the
+// Prometheus pod at ruleFilesDir by makeStatefulSetSpec.
+func makeRulesConfigMap(p *spec.Prometheus, rules map[string]*spec.PrometheusRule) (*v1.ConfigMap, map[string]error, error) {
+	data, invalid, err := generateRuleFileConfigs(rules)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &v1.ConfigMap{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      rulesConfigMapName(p),
+			Namespace: p.Namespace,
+		},
+		Data: data,
+	}, invalid, nil
+}
+
+func rulesConfigMapName(p *spec.Prometheus) string {
+	return fmt.Sprintf("%s-rules", p.Name)
+}
+
+// ruleFilePaths returns the mounted paths of every valid PrometheusRule's
+// rendered rule file, sorted by file name so the result - and therefore the
+// rendered Prometheus config - is stable across reconciles regardless of Go
+// map iteration order. Like generateRuleFileConfigs, it records the
+// validation outcome on each PrometheusRule's Status as a side effect.
+func ruleFilePaths(rules map[string]*spec.PrometheusRule) []string {
+	names := make([]string, 0, len(rules))
+	for _, pr := range rules {
+		if err := validateRuleGroups(pr); err != nil {
+			pr.Status = &spec.PrometheusRuleStatus{Valid: false, Reason: err.Error()}
+			continue
+		}
+		pr.Status = &spec.PrometheusRuleStatus{Valid: true}
+		names = append(names, ruleFileName(pr))
+	}
+	sort.Strings(names)
+
+	paths := make([]string, 0, len(names))
+	for _, name := range names {
+		paths = append(paths, fmt.Sprintf("%s/%s", ruleFilesDir, name))
+	}
+	return paths
+}
@@ -0,0 +1,288 @@
+// Copyright 2016 The prometheus-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"fmt"
+	"sort"
+
+	"k8s.io/client-go/pkg/api/resource"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/apis/apps/v1beta1"
+
+	"github.com/coreos/prometheus-operator/pkg/spec"
+)
+
+const secretsDir = "/etc/prometheus/secrets"
+
+// secretPath returns the path a key of the given Secret is mounted at in
+// the Prometheus container. generateConfig and makeStatefulSet must agree
+// on this layout so that scrape configs referencing Secret-backed
+// credentials point at files that actually exist on disk.
+func secretPath(secretName, key string) string {
+	return fmt.Sprintf("%s/%s/%s", secretsDir, secretName, key)
+}
+
+// secretNamesFromEndpoint returns the names of the Secrets referenced by a
+// scrape endpoint's TLS, bearer token, and basic auth configuration. These
+// Secrets are mounted into the Prometheus pod itself (see secretVolumes), so
+// per the constraint documented on spec.TLSConfig/BasicAuth they must live
+// in the Prometheus resource's own namespace even when the endpoint comes
+// from a ServiceMonitor selected cross-namespace.
+func secretNamesFromEndpoint(ep spec.Endpoint) []string {
+	var names []string
+	if ep.TLSConfig != nil {
+		for _, sel := range []*v1.SecretKeySelector{ep.TLSConfig.CA, ep.TLSConfig.Cert, ep.TLSConfig.Key} {
+			if sel != nil {
+				names = append(names, sel.Name)
+			}
+		}
+	}
+	if ep.BearerTokenSecret != nil {
+		names = append(names, ep.BearerTokenSecret.Name)
+	}
+	if ep.BasicAuth != nil && ep.BasicAuth.Password != nil {
+		names = append(names, ep.BasicAuth.Password.Name)
+	}
+	return names
+}
+
+// listSecretNames collects the distinct names of every Secret referenced by
+// the given ServiceMonitors' endpoints, sorted for a stable volume order.
+func listSecretNames(mons map[string]*spec.ServiceMonitor) []string {
+	seen := map[string]struct{}{}
+	for _, mon := range mons {
+		for _, ep := range mon.Spec.Endpoints {
+			for _, name := range secretNamesFromEndpoint(ep) {
+				seen[name] = struct{}{}
+			}
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// secretVolumeName returns the Volume name a Secret is mounted under.
+func secretVolumeName(secretName string) string {
+	return "secret-" + sanitizeLabelName(secretName)
+}
+
+// secretVolumes builds the Volumes and VolumeMounts needed to make every
+// referenced Secret's keys available on disk at the paths secretPath
+// returns for them.
+func secretVolumes(names []string) ([]v1.Volume, []v1.VolumeMount) {
+	volumes := make([]v1.Volume, 0, len(names))
+	mounts := make([]v1.VolumeMount, 0, len(names))
+	for _, name := range names {
+		volumes = append(volumes, v1.Volume{
+			Name: secretVolumeName(name),
+			VolumeSource: v1.VolumeSource{
+				Secret: &v1.SecretVolumeSource{SecretName: name},
+			},
+		})
+		mounts = append(mounts, v1.VolumeMount{
+			Name:      secretVolumeName(name),
+			ReadOnly:  true,
+			MountPath: fmt.Sprintf("%s/%s", secretsDir, name),
+		})
+	}
+	return volumes, mounts
+}
+
+// makeStatefulSet builds the StatefulSet running a Prometheus server. It
+// mounts every Secret referenced by the given ServiceMonitors' scrape
+// credentials (TLS material, bearer tokens, basic auth passwords) so the
+// *_file references generateConfig emits for them resolve on disk, plus the
+// ConfigMap makeRulesConfigMap renders for rules selected by
+// p.Spec.RuleSelector.
+func makeStatefulSet(p *spec.Prometheus, mons map[string]*spec.ServiceMonitor, rules map[string]*spec.PrometheusRule, old *v1beta1.StatefulSet) *v1beta1.StatefulSet {
+	baseImage := p.Spec.BaseImage
+	if baseImage == "" {
+		baseImage = "quay.io/prometheus/prometheus"
+	}
+	version := p.Spec.Version
+	if version == "" {
+		version = "v1.5.2"
+	}
+	replicas := p.Spec.Replicas
+	if replicas < 1 {
+		replicas = 1
+	}
+	image := fmt.Sprintf("%s:%s", baseImage, version)
+
+	statefulset := &v1beta1.StatefulSet{
+		ObjectMeta: v1.ObjectMeta{
+			Name: p.Name,
+		},
+		Spec: makeStatefulSetSpec(p, image, replicas, mons, rules),
+	}
+	if vc := p.Spec.Storage; vc == nil {
+		statefulset.Spec.Template.Spec.Volumes = append(statefulset.Spec.Template.Spec.Volumes, v1.Volume{
+			Name: fmt.Sprintf("%s-db", p.Name),
+			VolumeSource: v1.VolumeSource{
+				EmptyDir: &v1.EmptyDirVolumeSource{},
+			},
+		})
+	} else {
+		pvc := v1.PersistentVolumeClaim{
+			ObjectMeta: v1.ObjectMeta{
+				Name: fmt.Sprintf("%s-db", p.Name),
+			},
+			Spec: v1.PersistentVolumeClaimSpec{
+				AccessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
+				Resources:   vc.Resources,
+				Selector:    vc.Selector,
+			},
+		}
+		if len(vc.Class) > 0 {
+			pvc.ObjectMeta.Annotations = map[string]string{
+				"volume.beta.kubernetes.io/storage-class": vc.Class,
+			}
+		}
+		statefulset.Spec.VolumeClaimTemplates = append(statefulset.Spec.VolumeClaimTemplates, pvc)
+	}
+
+	if old != nil {
+		statefulset.Annotations = old.Annotations
+	}
+	return statefulset
+}
+
+func makeStatefulSetSpec(p *spec.Prometheus, image string, replicas int32, mons map[string]*spec.ServiceMonitor, rules map[string]*spec.PrometheusRule) v1beta1.StatefulSetSpec {
+	commands := []string{
+		"/bin/prometheus",
+		fmt.Sprintf("-config.file=%s", "/etc/prometheus/config/prometheus.yaml"),
+		fmt.Sprintf("-storage.local.path=%s", "/var/prometheus/data"),
+		fmt.Sprintf("-web.listen-address=:%d", 9090),
+	}
+	if p.Spec.Retention != "" {
+		commands = append(commands, fmt.Sprintf("-storage.local.retention=%s", p.Spec.Retention))
+	}
+
+	secVolumes, secMounts := secretVolumes(listSecretNames(mons))
+
+	volumes := append([]v1.Volume{
+		{
+			Name: "config-volume",
+			VolumeSource: v1.VolumeSource{
+				ConfigMap: &v1.ConfigMapVolumeSource{
+					LocalObjectReference: v1.LocalObjectReference{Name: p.Name},
+				},
+			},
+		},
+		{
+			Name: "rules-volume",
+			VolumeSource: v1.VolumeSource{
+				ConfigMap: &v1.ConfigMapVolumeSource{
+					LocalObjectReference: v1.LocalObjectReference{Name: rulesConfigMapName(p)},
+				},
+			},
+		},
+	}, secVolumes...)
+
+	mounts := append([]v1.VolumeMount{
+		{
+			Name:      "config-volume",
+			MountPath: "/etc/prometheus/config",
+		},
+		{
+			Name:      "rules-volume",
+			MountPath: ruleFilesDir,
+		},
+		{
+			Name:      fmt.Sprintf("%s-db", p.Name),
+			MountPath: "/var/prometheus/data",
+		},
+	}, secMounts...)
+
+	return v1beta1.StatefulSetSpec{
+		ServiceName: "prometheus",
+		Replicas:    &replicas,
+		Template: v1.PodTemplateSpec{
+			ObjectMeta: v1.ObjectMeta{
+				Labels: map[string]string{
+					"app":        "prometheus",
+					"prometheus": p.Name,
+				},
+			},
+			Spec: v1.PodSpec{
+				// promtool catches a malformed rule file before Prometheus
+				// loads it, rather than the server silently ignoring
+				// `rule_files` entries it can't parse.
+				InitContainers: []v1.Container{
+					{
+						Name:    "rules-check",
+						Image:   image,
+						Command: []string{"/bin/promtool", "check", "rules", fmt.Sprintf("%s/*.rules", ruleFilesDir)},
+						VolumeMounts: []v1.VolumeMount{
+							{
+								Name:      "rules-volume",
+								ReadOnly:  true,
+								MountPath: ruleFilesDir,
+							},
+						},
+					},
+				},
+				Containers: []v1.Container{
+					{
+						Name:    p.Name,
+						Image:   image,
+						Command: commands,
+						Ports: []v1.ContainerPort{
+							{
+								Name:          "web",
+								ContainerPort: 9090,
+								Protocol:      v1.ProtocolTCP,
+							},
+						},
+						VolumeMounts: mounts,
+					},
+					{
+						Name:  "config-reloader",
+						Image: "jimmidyson/configmap-reload",
+						Args: []string{
+							"-webhook-url=http://localhost:9090/-/reload",
+							"-volume-dir=/etc/prometheus/config",
+							fmt.Sprintf("-volume-dir=%s", ruleFilesDir),
+						},
+						VolumeMounts: []v1.VolumeMount{
+							{
+								Name:      "config-volume",
+								ReadOnly:  true,
+								MountPath: "/etc/prometheus/config",
+							},
+							{
+								Name:      "rules-volume",
+								ReadOnly:  true,
+								MountPath: ruleFilesDir,
+							},
+						},
+						Resources: v1.ResourceRequirements{
+							Limits: v1.ResourceList{
+								v1.ResourceCPU:    resource.MustParse("5m"),
+								v1.ResourceMemory: resource.MustParse("10Mi"),
+							},
+						},
+					},
+				},
+				Volumes: volumes,
+			},
+		},
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright 2016 The prometheus-operator Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spec
+
+import (
+	"k8s.io/client-go/pkg/api/v1"
+	metav1 "k8s.io/client-go/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/util/intstr"
+)
+
+// Prometheus defines a Prometheus deployment.
+type Prometheus struct {
+	metav1.TypeMeta `json:",inline"`
+	v1.ObjectMeta   `json:"metadata,omitempty"`
+	Spec            PrometheusSpec `json:"spec"`
+}
+
+// PrometheusSpec holds specification parameters of a Prometheus deployment.
+type PrometheusSpec struct {
+	ServiceMonitorSelector *metav1.LabelSelector `json:"serviceMonitorSelector,omitempty"`
+	// RuleSelector selects PrometheusRule objects whose rule groups are
+	// loaded by this Prometheus. Selection is scoped to the Prometheus
+	// resource's own namespace. If nil, no PrometheusRule objects are
+	// selected.
+	RuleSelector *metav1.LabelSelector `json:"ruleSelector,omitempty"`
+	Version      string                `json:"version,omitempty"`
+	Repository   string                `json:"repository,omitempty"`
+	BaseImage    string                `json:"baseImage,omitempty"`
+	Replicas     int32                 `json:"replicas,omitempty"`
+	Retention    string                `json:"retention,omitempty"`
+	Storage      *StorageSpec          `json:"storage,omitempty"`
+	Alerting     AlertingSpec          `json:"alerting,omitempty"`
+}
+
+// AlertingSpec defines parameters for alerting configuration of Prometheus servers.
+type AlertingSpec struct {
+	Alertmanagers []AlertmanagerEndpoints `json:"alertmanagers"`
+}
+
+// AlertmanagerEndpoints defines a selection of a single Endpoints object
+// containing alertmanager IPs to fire alerts against.
+type AlertmanagerEndpoints struct {
+	Namespace string               `json:"namespace"`
+	Name      string               `json:"name"`
+	Port      intstr.IntOrString   `json:"port"`
+	Scheme    string               `json:"scheme,omitempty"`
+}
+
+// StorageSpec defines the configured storage for a group Prometheus servers.
+type StorageSpec struct {
+	Class     string                          `json:"class"`
+	Selector  *metav1.LabelSelector           `json:"selector,omitempty"`
+	Resources v1.ResourceRequirements         `json:"resources,omitempty"`
+}
+
+// ServiceMonitor defines monitoring for a set of services.
+type ServiceMonitor struct {
+	metav1.TypeMeta `json:",inline"`
+	v1.ObjectMeta   `json:"metadata,omitempty"`
+	Spec            ServiceMonitorSpec `json:"spec"`
+}
+
+// ServiceMonitorSpec contains specification parameters for a ServiceMonitor.
+type ServiceMonitorSpec struct {
+	JobLabel          string            `json:"jobLabel,omitempty"`
+	Selector          metav1.LabelSelector `json:"selector"`
+	NamespaceSelector NamespaceSelector `json:"namespaceSelector,omitempty"`
+	Endpoints         []Endpoint        `json:"endpoints"`
+}
+
+// Endpoint defines a scrapeable endpoint serving Prometheus metrics.
+type Endpoint struct {
+	Port       string             `json:"port,omitempty"`
+	TargetPort intstr.IntOrString `json:"targetPort,omitempty"`
+	Path       string             `json:"path,omitempty"`
+	Scheme     string             `json:"scheme,omitempty"`
+	Interval   string             `json:"interval,omitempty"`
+	// Role selects the Kubernetes service discovery role used to find
+	// scrape targets for this endpoint. One of "endpoints" or "pod".
+	// Defaults to "endpoints".
+	Role string `json:"role,omitempty"`
+
+	// TLSConfig configures the TLS settings used when scraping the endpoint.
+	TLSConfig *TLSConfig `json:"tlsConfig,omitempty"`
+	// BearerTokenSecret selects a key of a Secret containing a bearer token
+	// used for authentication when scraping the endpoint. The operator
+	// mounts the referenced Secret into the Prometheus pod. The Secret must
+	// live in the same namespace as the Prometheus resource, not the
+	// ServiceMonitor's namespace - see the note on TLSConfig.
+	BearerTokenSecret *v1.SecretKeySelector `json:"bearerTokenSecret,omitempty"`
+	// BasicAuth configures HTTP basic authentication used when scraping the
+	// endpoint.
+	BasicAuth *BasicAuth `json:"basicAuth,omitempty"`
+}
+
+// TLSConfig specifies the TLS configuration used when scraping an endpoint.
+// CA, Cert and Key each select a key of a Secret; the operator mounts the
+// referenced Secrets into the Prometheus pod so the rendered file paths
+// resolve on disk. Since the Secret is mounted into the Prometheus pod
+// itself, it must live in the Prometheus resource's own namespace - a
+// ServiceMonitor selected cross-namespace via NamespaceSelector still has to
+// reference Secrets that exist alongside the Prometheus it's scraped by, not
+// alongside the ServiceMonitor.
+type TLSConfig struct {
+	CA                 *v1.SecretKeySelector `json:"ca,omitempty"`
+	Cert               *v1.SecretKeySelector `json:"cert,omitempty"`
+	Key                *v1.SecretKeySelector `json:"key,omitempty"`
+	ServerName         string                `json:"serverName,omitempty"`
+	InsecureSkipVerify bool                  `json:"insecureSkipVerify,omitempty"`
+}
+
+// BasicAuth configures HTTP basic authentication credentials. Password
+// selects a key of a Secret, mirroring how TLS material is referenced; the
+// operator mounts the Secret into the Prometheus pod and Prometheus reads
+// the password from the mounted file. Username is not considered sensitive
+// and is taken as a literal value. As with TLSConfig, Password's Secret must
+// live in the Prometheus resource's own namespace.
+type BasicAuth struct {
+	Username string                `json:"username,omitempty"`
+	Password *v1.SecretKeySelector `json:"password,omitempty"`
+}
+
+// NamespaceSelector is a selector for selecting either all namespaces, an
+// explicit list of namespaces, or namespaces matching a label selector.
+type NamespaceSelector struct {
+	Any        bool     `json:"any,omitempty"`
+	MatchNames []string `json:"matchNames,omitempty"`
+	// Selector, if set, is resolved against the cluster's Namespace objects
+	// to produce the concrete list of namespaces to discover targets in.
+	// Only used when Any is false and MatchNames is empty.
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+}
+
+// PrometheusRule defines a set of Prometheus rule groups to be loaded by a
+// Prometheus server.
+type PrometheusRule struct {
+	metav1.TypeMeta `json:",inline"`
+	v1.ObjectMeta   `json:"metadata,omitempty"`
+	Spec            PrometheusRuleSpec    `json:"spec"`
+	Status          *PrometheusRuleStatus `json:"status,omitempty"`
+}
+
+// PrometheusRuleStatus reports the validity of a PrometheusRule's groups as
+// last checked by the operator.
+type PrometheusRuleStatus struct {
+	// Valid is false if any rule group in Spec.Groups failed the operator's
+	// structural validation, in which case the whole PrometheusRule was
+	// excluded from the rendered rule files.
+	Valid bool `json:"valid"`
+	// Reason explains why Valid is false. Empty when Valid is true.
+	Reason string `json:"reason,omitempty"`
+}
+
+// PrometheusRuleSpec contains specification parameters for a PrometheusRule.
+type PrometheusRuleSpec struct {
+	Groups []RuleGroup `json:"groups,omitempty"`
+}
+
+// RuleGroup is a list of sequentially evaluated recording and alerting rules.
+type RuleGroup struct {
+	Name     string `json:"name" yaml:"name"`
+	Interval string `json:"interval,omitempty" yaml:"interval,omitempty"`
+	Rules    []Rule `json:"rules" yaml:"rules"`
+}
+
+// Rule describes a single recording or alerting rule.
+type Rule struct {
+	Record      string            `json:"record,omitempty" yaml:"record,omitempty"`
+	Alert       string            `json:"alert,omitempty" yaml:"alert,omitempty"`
+	Expr        string            `json:"expr" yaml:"expr"`
+	For         string            `json:"for,omitempty" yaml:"for,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty"`
+}
+
+// Alertmanager defines an Alertmanager deployment.
+type Alertmanager struct {
+	metav1.TypeMeta `json:",inline"`
+	v1.ObjectMeta   `json:"metadata,omitempty"`
+	Spec            AlertmanagerSpec    `json:"spec"`
+	Status          *AlertmanagerStatus `json:"status,omitempty"`
+}
+
+// AlertmanagerSpec holds specification parameters of an Alertmanager deployment.
+type AlertmanagerSpec struct {
+	Version   string       `json:"version,omitempty"`
+	BaseImage string       `json:"baseImage,omitempty"`
+	Replicas  int32        `json:"replicas,omitempty"`
+	Storage   *StorageSpec `json:"storage,omitempty"`
+
+	// NodeSelector constrains the Alertmanager pods onto nodes carrying the
+	// given labels.
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// Affinity, if set, is applied to the Alertmanager pods verbatim. If
+	// unset and Replicas is greater than one, a default anti-affinity rule
+	// is generated to spread replicas across nodes.
+	Affinity *v1.Affinity `json:"affinity,omitempty"`
+	// Tolerations, if specified, are the pod's tolerations.
+	Tolerations []v1.Toleration `json:"tolerations,omitempty"`
+	// AdditionalPeers are mesh peer addresses added on top of the
+	// membership resolved from the headless Service's Endpoints, for
+	// peering with Alertmanagers outside this cluster.
+	AdditionalPeers []string `json:"additionalPeers,omitempty"`
+}
+
+// AlertmanagerStatus reports observed state of an Alertmanager deployment.
+type AlertmanagerStatus struct {
+	// Peers is the mesh peer list last resolved for this Alertmanager.
+	Peers []string `json:"peers,omitempty"`
+}